@@ -19,26 +19,40 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/medik8s/common/pkg/lease"
 	"go.uber.org/zap/zapcore"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	nodemaintenancev1beta1 "github.com/medik8s/node-maintenance-operator/api/v1beta1"
@@ -52,6 +66,11 @@ const (
 	WebhookCertDir  = "/apiserver.local.config/certificates"
 	WebhookCertName = "apiserver.crt"
 	WebhookKeyName  = "apiserver.key"
+
+	// OpenShiftMetricsCertDir is where the service-ca operator projects the cert/key pair
+	// for the metrics service when the ServingCertSecret annotation is used, as OLM sets up
+	// for this operator's metrics Service on OpenShift.
+	OpenShiftMetricsCertDir = "/etc/pki/tls/metrics-certs"
 )
 
 var (
@@ -68,16 +87,42 @@ func init() {
 
 func main() {
 	var (
-		metricsAddr, probeAddr string
+		metricsAddr, probeAddr            string
 		enableLeaderElection, enableHTTP2 bool
-		webhookOpts          webhook.Options
-	) 
+		webhookOpts                       webhook.Options
+		reconcileStallThreshold           time.Duration
+		watchNamespaces, disableCacheFor  string
+		metricsSecure                     bool
+		metricsCertDir                    string
+		apiWaitTimeout                    time.Duration
+	)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false, "If HTTP/2 should be enabled for the metrics and webhook servers.")
+	flag.DurationVar(&reconcileStallThreshold, "reconcile-stall-threshold", 10*time.Minute,
+		"The liveness check reports unhealthy if no reconcile has succeeded within this duration since the last one.")
+	flag.StringVar(&watchNamespaces, "watch-namespace", "",
+		"Comma-separated list of namespaces to restrict the manager's watches and caches to. "+
+			"Defaults to empty, which means watch all namespaces cluster-wide. Restricting this trades "+
+			"visibility of namespaced objects outside the listed namespaces (cluster-scoped objects such as "+
+			"Nodes are still cached cluster-wide) for a much smaller informer cache footprint and faster "+
+			"startup on large clusters.")
+	flag.StringVar(&disableCacheFor, "disable-cache-for", "",
+		"Comma-separated list of resources (secrets, configmaps, leases) to bypass the informer cache for "+
+			"and read directly from the API server instead. Trades a small amount of added read latency "+
+			"for not caching objects the operator only reads rarely.")
+	flag.BoolVar(&metricsSecure, "metrics-secure", false,
+		"If set, the metrics endpoint is served over TLS and requests are authenticated/authorized against "+
+			"the Kubernetes API via TokenReview/SubjectAccessReview. Defaults to true automatically on OpenShift.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"Directory containing tls.crt/tls.key to serve the metrics endpoint with when --metrics-secure is set. "+
+			"On OpenShift this defaults to the service-CA-generated cert directory.")
+	flag.DurationVar(&apiWaitTimeout, "api-wait-timeout", 2*time.Minute,
+		"How long to wait for the Kubernetes API server to become ready before giving up and exiting non-zero, "+
+			"so the kubelet restarts the pod, instead of panicking on a transient control-plane rollout.")
 
 	opts := zap.Options{
 		Development: true,
@@ -90,44 +135,87 @@ func main() {
 
 	printVersion()
 
-	configureWebhookOpts(&webhookOpts, enableHTTP2)
+	webhookCertsInjected := configureWebhookOpts(&webhookOpts, enableHTTP2)
+
+	// ctx is cancelled on SIGTERM and drives the workload manager directly. The election
+	// manager gets its own context, cancelled only once the workload manager has finished
+	// shutting down, so finalizer logic and webhook inhibition complete before the lease
+	// is released.
+	ctx := ctrl.SetupSignalHandler()
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+
+	restConfig := ctrl.GetConfigOrDie()
+
+	if err := waitForAPIServer(ctx, restConfig, apiWaitTimeout); err != nil {
+		setupLog.Error(err, "API server did not become ready within the wait timeout")
+		os.Exit(1)
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
+	openshiftCheck, err := utils.NewOpenshiftValidator(restConfig)
+	if err != nil {
+		setupLog.Error(err, "failed to check if we run on Openshift")
+		os.Exit(1)
+	}
+	isOpenShift := openshiftCheck.IsOpenshiftSupported()
+	if isOpenShift {
+		setupLog.Info("NMO was installed on Openshift cluster")
+	}
+
+	if isOpenShift && !isFlagSet("metrics-secure") {
+		metricsSecure = true
+	}
+	metricsServerOpts := configureMetricsOpts(metricsAddr, metricsSecure, metricsCertDir, isOpenShift)
+
+	var electionMgr ctrl.Manager
+	if enableLeaderElection {
+		var err error
+		electionMgr, err = ctrl.NewManager(restConfig, ctrl.Options{
+			Scheme:                        scheme,
+			LeaderElection:                true,
+			LeaderElectionID:              "135b1886.medik8s.io",
+			LeaderElectionReleaseOnCancel: true,
+			HealthProbeBindAddress:        "0",
+			Metrics:                       metricsserver.Options{BindAddress: "0"},
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to start leader election manager")
+			os.Exit(1)
+		}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsServerOpts,
 		WebhookServer:          webhook.NewServer(webhookOpts),
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "135b1886.medik8s.io",
+		LeaderElection:         false,
+		Cache: cache.Options{
+			DefaultNamespaces: namespacesToCacheConfig(watchNamespaces),
+		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				DisableFor: disableCacheForObjects(disableCacheFor),
+			},
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-
 	cl := mgr.GetClient()
 	leaseManagerInitializer := &leaseManagerInitializer{cl: cl}
 	if err := mgr.Add(leaseManagerInitializer); err != nil {
 		setupLog.Error(err, "unable to set up lease Manager", "lease", "NodeMaintenance")
 		os.Exit(1)
 	}
-	
-	openshiftCheck,err := utils.NewOpenshiftValidator(mgr.GetConfig())
-	if err != nil {
-		setupLog.Error(err, "failed to check if we run on Openshift")
-		os.Exit(1)
-	}
-	isOpenShift := openshiftCheck.IsOpenshiftSupported()
-	if isOpenShift{
-		setupLog.Info("NMO was installed on Openshift cluster")
-	}
-	
 
-	if err = (&controllers.NodeMaintenanceReconciler{
+	nodeMaintenanceReconciler := &controllers.NodeMaintenanceReconciler{
 		Client:       cl,
 		Scheme:       mgr.GetScheme(),
 		LeaseManager: leaseManagerInitializer,
-	}).SetupWithManager(mgr); err != nil {
+	}
+	if err = nodeMaintenanceReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NodeMaintenance")
 		os.Exit(1)
 	}
@@ -137,20 +225,70 @@ func main() {
 	}
 	//+kubebuilder:scaffold:builder
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+	var cacheSynced int32
+	go func() {
+		if mgr.GetCache().WaitForCacheSync(ctx) {
+			atomic.StoreInt32(&cacheSynced, 1)
+		}
+	}()
+
+	// leaderAcquired gates readiness only, never the workload manager's HTTP listener: the
+	// /healthz and /readyz endpoints must be bound and answering the moment mgr.Start runs,
+	// so a standby replica waiting on the lease still passes kubelet's liveness probe.
+	var leaderAcquired int32
+	if electionMgr == nil {
+		// No leader election configured: this replica is implicitly "leading".
+		atomic.StoreInt32(&leaderAcquired, 1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+
+	if err := mgr.AddReadyzCheck("readyz", readinessCheck(leaseManagerInitializer, &cacheSynced, &leaderAcquired)); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddHealthzCheck("healthz", livenessCheck(nodeMaintenanceReconciler, reconcileStallThreshold)); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if webhookCertsInjected {
+		if err := mgr.AddHealthzCheck("webhook-cert", webhookCertCheck); err != nil {
+			setupLog.Error(err, "unable to set up webhook cert check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	mgrDone := make(chan error, 1)
+	go func() { mgrDone <- mgr.Start(ctx) }()
+
+	electionDone := make(chan struct{})
+	if electionMgr != nil {
+		go func() {
+			defer close(electionDone)
+			if err := electionMgr.Start(electionCtx); err != nil && electionCtx.Err() == nil {
+				setupLog.Error(err, "problem running leader election manager")
+				os.Exit(1)
+			}
+		}()
+		go func() {
+			setupLog.Info("waiting to become leader")
+			<-electionMgr.Elected()
+			atomic.StoreInt32(&leaderAcquired, 1)
+			setupLog.Info("acquired leadership")
+		}()
+	}
+
+	if err := <-mgrDone; err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	// ctx is already cancelled here (mgr.Start only returns after shutdown completes), so
+	// the workload manager's finalizer/webhook-inhibition teardown is done. Only now cancel
+	// the election manager, releasing the lease, and wait for it to return before exiting.
+	cancelElection()
+	if electionMgr != nil {
+		<-electionDone
+	}
 }
 
 func printVersion() {
@@ -172,7 +310,9 @@ func (ls *leaseManagerInitializer) Start(context.Context) error {
 	return err
 }
 
-func configureWebhookOpts(webhookOpts *webhook.Options, enableHTTP2 bool) {
+// configureWebhookOpts sets up webhookOpts for the OLM-injected certs, if present, and
+// reports whether it did so, so callers can decide whether a cert health check makes sense.
+func configureWebhookOpts(webhookOpts *webhook.Options, enableHTTP2 bool) bool {
 
 	certs := []string{filepath.Join(WebhookCertDir, WebhookCertName), filepath.Join(WebhookCertDir, WebhookKeyName)}
 	certsInjected := true
@@ -202,4 +342,165 @@ func configureWebhookOpts(webhookOpts *webhook.Options, enableHTTP2 bool) {
 		setupLog.Info("HTTP/2 for webhooks enabled")
 	}
 
+	return certsInjected
+}
+
+// waitForAPIServer polls the discovered API server's /readyz with backoff, using the
+// config's own CA bundle and bearer token, and returns once it answers 200 or timeout
+// elapses. This covers the brief control-plane rollouts the clusters this operator manages
+// are themselves prone to, where ctrl.NewManager would otherwise panic or fail fast.
+func waitForAPIServer(ctx context.Context, cfg *rest.Config, timeout time.Duration) error {
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to build an http client from the discovered kubeconfig: %w", err)
+	}
+	readyzURL := strings.TrimRight(cfg.Host, "/") + "/readyz"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := wait.Backoff{Duration: time.Second, Factor: 1.5, Jitter: 0.1, Steps: math.MaxInt32}
+	return wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, readyzURL, nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			setupLog.Info("API server not yet reachable, retrying", "error", err.Error())
+			return false, nil
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			setupLog.Info("API server not yet ready, retrying", "statusCode", resp.StatusCode)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// isFlagSet reports whether name was explicitly passed on the command line, as opposed to
+// left at its default value.
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// configureMetricsOpts builds the metrics server options for the workload manager. When
+// secure is set, requests are authenticated/authorized against the Kubernetes API via
+// TokenReview/SubjectAccessReview instead of being served in the clear. On OpenShift, a
+// missing certDir falls back to the service-CA-generated cert directory.
+func configureMetricsOpts(metricsAddr string, secure bool, certDir string, isOpenShift bool) metricsserver.Options {
+	opts := metricsserver.Options{
+		BindAddress:   metricsAddr,
+		SecureServing: secure,
+	}
+	if !secure {
+		return opts
+	}
+	opts.FilterProvider = filters.WithAuthenticationAndAuthorization
+	if certDir == "" && isOpenShift {
+		certDir = OpenShiftMetricsCertDir
+	}
+	opts.CertDir = certDir
+	return opts
+}
+
+// namespacesToCacheConfig turns a comma-separated --watch-namespace value into the
+// per-namespace cache config ctrl.Options.Cache.DefaultNamespaces expects. An empty value
+// returns nil, which keeps the manager cluster-scoped.
+func namespacesToCacheConfig(watchNamespaces string) map[string]cache.Config {
+	if watchNamespaces == "" {
+		return nil
+	}
+	namespaces := map[string]cache.Config{}
+	for _, ns := range strings.Split(watchNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = cache.Config{}
+		}
+	}
+	return namespaces
+}
+
+// disableCacheForObjects turns a comma-separated --disable-cache-for value into the list of
+// object types client.Options.Cache.DisableFor expects, so those reads bypass the informer
+// cache and go straight to the API server.
+func disableCacheForObjects(disableCacheFor string) []client.Object {
+	var objs []client.Object
+	for _, name := range strings.Split(disableCacheFor, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "secret", "secrets":
+			objs = append(objs, &corev1.Secret{})
+		case "configmap", "configmaps":
+			objs = append(objs, &corev1.ConfigMap{})
+		case "lease", "leases":
+			objs = append(objs, &coordinationv1.Lease{})
+		}
+	}
+	return objs
+}
+
+// readinessCheck reports ready only once the lease manager has been initialized by
+// leaseManagerInitializer.Start, the manager's informer caches have synced, and (when leader
+// election is enabled) this replica has acquired leadership on the dedicated election
+// manager, closing the startup window in which the reconciler could otherwise see a nil
+// LeaseManager or a standby replica could appear ready.
+func readinessCheck(leaseInit *leaseManagerInitializer, cacheSynced, leaderAcquired *int32) healthz.Checker {
+	return func(_ *http.Request) error {
+		if leaseInit.Manager == nil {
+			return fmt.Errorf("lease manager is not yet initialized")
+		}
+		if atomic.LoadInt32(cacheSynced) == 0 {
+			return fmt.Errorf("informer caches are not yet synced")
+		}
+		if atomic.LoadInt32(leaderAcquired) == 0 {
+			return fmt.Errorf("leadership has not yet been acquired")
+		}
+		return nil
+	}
+}
+
+// livenessCheck reports unhealthy once reconciler has gone longer than stallThreshold
+// since its last successful reconcile, so a wedged controller gets restarted by the kubelet.
+func livenessCheck(reconciler *controllers.NodeMaintenanceReconciler, stallThreshold time.Duration) healthz.Checker {
+	return func(_ *http.Request) error {
+		last := reconciler.LastSuccessfulReconcile()
+		if last.IsZero() {
+			return nil
+		}
+		if stalledFor := time.Since(last); stalledFor > stallThreshold {
+			return fmt.Errorf("no successful reconcile in %s, exceeding the %s threshold", stalledFor, stallThreshold)
+		}
+		return nil
+	}
+}
+
+// webhookCertCheck re-stats the OLM-injected webhook cert on every probe and fails if the
+// files have disappeared or the certificate is within 24h of expiring.
+func webhookCertCheck(_ *http.Request) error {
+	certPath := filepath.Join(WebhookCertDir, WebhookCertName)
+	keyPath := filepath.Join(WebhookCertDir, WebhookKeyName)
+	if _, err := os.Stat(keyPath); err != nil {
+		return fmt.Errorf("webhook key %s is missing: %w", keyPath, err)
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("webhook cert %s is not readable: %w", certPath, err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return fmt.Errorf("webhook cert %s is not valid PEM", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("webhook cert %s could not be parsed: %w", certPath, err)
+	}
+	if timeLeft := time.Until(cert.NotAfter); timeLeft < 24*time.Hour {
+		return fmt.Errorf("webhook cert %s expires in %s", certPath, timeLeft)
+	}
+	return nil
 }
@@ -0,0 +1,103 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// TestManagerOnlyCachesWatchedNamespaces exercises --watch-namespace end to end: a manager
+// built with namespacesToCacheConfig should only surface objects created in the watched
+// namespace through its cache, even though both namespaces exist on the API server.
+func TestManagerOnlyCachesWatchedNamespaces(t *testing.T) {
+	testEnv := &envtest.Environment{}
+	cfg, err := testEnv.Start()
+	if err != nil {
+		t.Fatalf("unable to start envtest environment: %v", err)
+	}
+	defer func() {
+		if err := testEnv.Stop(); err != nil {
+			t.Logf("unable to stop envtest environment: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apiClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatalf("unable to create api client: %v", err)
+	}
+
+	const watchedNamespace = "nmo-watched"
+	const otherNamespace = "nmo-other"
+	for _, ns := range []string{watchedNamespace, otherNamespace} {
+		if err := apiClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+			t.Fatalf("unable to create namespace %s: %v", ns, err)
+		}
+	}
+	for _, ns := range []string{watchedNamespace, otherNamespace} {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "probe", Namespace: ns}}
+		if err := apiClient.Create(ctx, cm); err != nil {
+			t.Fatalf("unable to create configmap in %s: %v", ns, err)
+		}
+	}
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		Cache: cache.Options{
+			DefaultNamespaces: namespacesToCacheConfig(watchedNamespace),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to create manager: %v", err)
+	}
+
+	cacheStarted := make(chan error, 1)
+	go func() { cacheStarted <- mgr.GetCache().Start(ctx) }()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		t.Fatalf("cache never synced")
+	}
+
+	var cms corev1.ConfigMapList
+	if err := mgr.GetCache().List(ctx, &cms); err != nil {
+		t.Fatalf("unable to list configmaps via cache: %v", err)
+	}
+
+	if len(cms.Items) != 1 || cms.Items[0].Namespace != watchedNamespace {
+		t.Fatalf("expected the cache to only see objects from %q, got %+v", watchedNamespace, cms.Items)
+	}
+
+	cancel()
+	select {
+	case <-cacheStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cache did not stop after context cancellation")
+	}
+}